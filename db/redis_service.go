@@ -1,14 +1,23 @@
 package db
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/xuri/excelize/v2"
 	"io"
 	"log"
+	"math/rand"
+	"os"
 	"rollcall-server-go/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -16,20 +25,58 @@ const (
 	classInfoPrefix     = "class:"   // Hash prefix: class:{id} -> stores class details
 	classStudentsPrefix = "class:"   // Set prefix: class:{id}:students -> stores student IDs for a class
 	studentInfoPrefix   = "student:" // Hash prefix: student:{id} -> stores student details
+	classCalledPrefix   = "class:"   // Set prefix: class:{id}:called -> stores student IDs already picked in the current round
+	classHistoryPrefix  = "class:"   // Sorted set prefix: class:{id}:history -> "{studentId}:{unixNano}" scored by pick time (unix milliseconds)
 )
 
+var (
+	// ErrClassNotFound is returned when an operation targets a class that does not exist
+	ErrClassNotFound = errors.New("class not found")
+	// ErrStudentNotFound is returned when an operation targets a student that does not exist
+	ErrStudentNotFound = errors.New("student not found")
+	// ErrClassAlreadyExists is returned by AddClass when the class ID is already taken
+	ErrClassAlreadyExists = errors.New("class already exists")
+	// ErrStudentAlreadyExists is returned by AddStudent when the student ID is already taken
+	ErrStudentAlreadyExists = errors.New("student already exists")
+)
+
+// DefaultOpTimeout is the per-operation deadline applied when RedisService.OpTimeout is not changed
+const DefaultOpTimeout = 5 * time.Second
+
 // RedisService handles operations with the Redis database
 type RedisService struct {
-	Client *redis.Client
-	Ctx    context.Context // Base context
+	Client    *redis.Client
+	OpTimeout time.Duration // Deadline for each service call, on top of the caller's context; 0 disables it
 }
 
 // NewRedisService creates a new RedisService instance
 func NewRedisService(client *redis.Client) *RedisService {
 	return &RedisService{
-		Client: client,
-		Ctx:    context.Background(), // Use a background context as base
+		Client:    client,
+		OpTimeout: DefaultOpTimeout,
+	}
+}
+
+// withTimeout derives the context for a single service call, so a stalled Redis can't hold the caller forever
+func (s *RedisService) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.OpTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.OpTimeout)
+}
+
+// maxTxRetries bounds how often an optimistic WATCH transaction is retried when its keys change underneath it
+const maxTxRetries = 5
+
+// watchWithRetry runs fn inside WATCH on keys, retrying when the transaction is aborted by a concurrent write
+func (s *RedisService) watchWithRetry(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error {
+	for i := 0; i < maxTxRetries; i++ {
+		err := s.Client.Watch(ctx, fn, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
 	}
+	return fmt.Errorf("transaction aborted after %d retries due to concurrent updates: %w", maxTxRetries, redis.TxFailedErr)
 }
 
 // Helper to generate class info key
@@ -42,6 +89,16 @@ func getClassStudentsKey(classID string) string {
 	return classStudentsPrefix + classID + ":students"
 }
 
+// Helper to generate class called set key
+func getClassCalledKey(classID string) string {
+	return classCalledPrefix + classID + ":called"
+}
+
+// Helper to generate class history sorted set key
+func getClassHistoryKey(classID string) string {
+	return classHistoryPrefix + classID + ":history"
+}
+
 // Helper to generate student info key
 func getStudentInfoKey(studentID string) string {
 	return studentInfoPrefix + studentID
@@ -49,35 +106,48 @@ func getStudentInfoKey(studentID string) string {
 
 // --- Class Operations ---
 
-// AddClass adds a new class to Redis
-func (s *RedisService) AddClass(clazz models.Clazz) error {
+// addClassScript adds a class only if its ID is not yet in the classes set.
+// KEYS[1] = classes set, KEYS[2] = class info hash, ARGV = id, name. Returns 1 if added, 0 if it already existed.
+var addClassScript = redis.NewScript(`
+if redis.call('SADD', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[2], 'id', ARGV[1], 'name', ARGV[2])
+return 1
+`)
+
+// AddClass adds a new class to Redis.
+// Returns ErrClassAlreadyExists if the class ID is already taken, use UpdateClass to rename.
+func (s *RedisService) AddClass(ctx context.Context, clazz models.Clazz) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	if clazz.ID == "" || clazz.Name == "" {
 		return errors.New("class ID and Name cannot be empty")
 	}
-	classKey := getClassInfoKey(clazz.ID)
-	pipe := s.Client.Pipeline()
-
-	// Add class ID to the global set of classes
-	pipe.SAdd(s.Ctx, classesKey, clazz.ID)
-	// Store class details in a Hash
-	pipe.HMSet(s.Ctx, classKey, map[string]interface{}{
-		"id":   clazz.ID,
-		"name": clazz.Name,
-	})
-
-	_, err := pipe.Exec(s.Ctx)
+	// The existence check and the write happen in one script so concurrent adds of the same ID can't both succeed
+	added, err := addClassScript.Run(ctx, s.Client,
+		[]string{classesKey, getClassInfoKey(clazz.ID)},
+		clazz.ID, clazz.Name,
+	).Int64()
 	if err != nil {
 		log.Printf("Error adding class %s: %v", clazz.ID, err)
 		return fmt.Errorf("failed to add class to Redis: %w", err)
 	}
+	if added == 0 {
+		return ErrClassAlreadyExists
+	}
 	log.Printf("Added class: %s (%s)", clazz.Name, clazz.ID)
 	return nil
 }
 
 // GetClassByID retrieves a class by its ID
-func (s *RedisService) GetClassByID(classID string) (*models.Clazz, error) {
+func (s *RedisService) GetClassByID(ctx context.Context, classID string) (*models.Clazz, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	classKey := getClassInfoKey(classID)
-	data, err := s.Client.HGetAll(s.Ctx, classKey).Result()
+	data, err := s.Client.HGetAll(ctx, classKey).Result()
 
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
@@ -97,8 +167,11 @@ func (s *RedisService) GetClassByID(classID string) (*models.Clazz, error) {
 }
 
 // GetAllClasses retrieves all classes
-func (s *RedisService) GetAllClasses() ([]models.Clazz, error) {
-	classIDs, err := s.Client.SMembers(s.Ctx, classesKey).Result()
+func (s *RedisService) GetAllClasses(ctx context.Context) ([]models.Clazz, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	classIDs, err := s.Client.SMembers(ctx, classesKey).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			return []models.Clazz{}, nil // No classes found
@@ -109,7 +182,7 @@ func (s *RedisService) GetAllClasses() ([]models.Clazz, error) {
 
 	classes := make([]models.Clazz, 0, len(classIDs))
 	for _, id := range classIDs {
-		clazz, err := s.GetClassByID(id)
+		clazz, err := s.GetClassByID(ctx, id)
 		if err != nil {
 			// Log the error but continue trying to fetch others
 			log.Printf("Error fetching details for class %s: %v", id, err)
@@ -123,8 +196,11 @@ func (s *RedisService) GetAllClasses() ([]models.Clazz, error) {
 }
 
 // ClassExists checks if a class ID exists in the classes set
-func (s *RedisService) ClassExists(classID string) (bool, error) {
-	exists, err := s.Client.SIsMember(s.Ctx, classesKey, classID).Result()
+func (s *RedisService) ClassExists(ctx context.Context, classID string) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	exists, err := s.Client.SIsMember(ctx, classesKey, classID).Result()
 	if err != nil {
 		log.Printf("Error checking existence for class %s: %v", classID, err)
 		return false, fmt.Errorf("failed to check class existence: %w", err)
@@ -132,55 +208,244 @@ func (s *RedisService) ClassExists(classID string) (bool, error) {
 	return exists, nil
 }
 
+// updateClassScript renames a class only if its ID is in the classes set.
+// KEYS[1] = classes set, KEYS[2] = class info hash, ARGV = id, name. Returns 1 if updated, 0 if the class does not exist.
+var updateClassScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[2], 'name', ARGV[2])
+return 1
+`)
+
+// UpdateClass renames an existing class.
+// Returns ErrClassNotFound if the class does not exist.
+func (s *RedisService) UpdateClass(ctx context.Context, clazz models.Clazz) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if clazz.ID == "" || clazz.Name == "" {
+		return errors.New("class ID and Name cannot be empty")
+	}
+	// The existence check and the write happen in one script so a concurrent DeleteClass can't leave an orphaned hash
+	updated, err := updateClassScript.Run(ctx, s.Client,
+		[]string{classesKey, getClassInfoKey(clazz.ID)},
+		clazz.ID, clazz.Name,
+	).Int64()
+	if err != nil {
+		log.Printf("Error updating class %s: %v", clazz.ID, err)
+		return fmt.Errorf("failed to update class in Redis: %w", err)
+	}
+	if updated == 0 {
+		return ErrClassNotFound
+	}
+	log.Printf("Updated class: %s (%s)", clazz.Name, clazz.ID)
+	return nil
+}
+
+// DeleteClass removes a class along with all of its students.
+// Returns ErrClassNotFound if the class does not exist.
+func (s *RedisService) DeleteClass(ctx context.Context, classID string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	exists, err := s.ClassExists(ctx, classID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrClassNotFound
+	}
+
+	classStudentsKey := getClassStudentsKey(classID)
+	var studentIDs []string
+	// WATCH the student set so a student added concurrently aborts (and retries) the delete
+	// instead of leaving its student:{id} hash orphaned
+	err = s.watchWithRetry(ctx, func(tx *redis.Tx) error {
+		var err error
+		studentIDs, err = tx.SMembers(ctx, classStudentsKey).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			// Remove class ID from the global set of classes
+			pipe.SRem(ctx, classesKey, classID)
+			// Remove class details
+			pipe.Del(ctx, getClassInfoKey(classID))
+			// Remove every student hash belonging to the class
+			if len(studentIDs) > 0 {
+				studentKeys := make([]string, 0, len(studentIDs))
+				for _, id := range studentIDs {
+					studentKeys = append(studentKeys, getStudentInfoKey(id))
+				}
+				pipe.Del(ctx, studentKeys...)
+			}
+			// Remove the class's student set, roll call state and history
+			pipe.Del(ctx, classStudentsKey, getClassCalledKey(classID), getClassHistoryKey(classID))
+			return nil
+		})
+		return err
+	}, classStudentsKey)
+	if err != nil {
+		log.Printf("Error deleting class %s: %v", classID, err)
+		return fmt.Errorf("failed to delete class from Redis: %w", err)
+	}
+	log.Printf("Deleted class %s and %d students", classID, len(studentIDs))
+	return nil
+}
+
 // --- Student Operations ---
 
-// AddStudent adds a student to a class
-func (s *RedisService) AddStudent(student models.Student) error {
+// addStudentScript adds a student only if its hash does not exist yet.
+// KEYS[1] = student info hash, KEYS[2] = class students set, ARGV = id, name, classId.
+// Returns 1 if added, 0 if the student already existed.
+var addStudentScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('SADD', KEYS[2], ARGV[1])
+redis.call('HSET', KEYS[1], 'id', ARGV[1], 'name', ARGV[2], 'classId', ARGV[3])
+return 1
+`)
+
+// AddStudent adds a student to a class.
+// Returns ErrStudentAlreadyExists if the student ID is already taken, use UpdateStudent to change it.
+func (s *RedisService) AddStudent(ctx context.Context, student models.Student) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	if student.ID == "" || student.Name == "" || student.ClassID == "" {
 		return errors.New("student ID, Name, and ClassID cannot be empty")
 	}
 
 	// Check if class exists (optional, but good practice)
-	exists, err := s.ClassExists(student.ClassID)
+	exists, err := s.ClassExists(ctx, student.ClassID)
 	if err != nil {
 		return err // Error checking existence
 	}
 	if !exists {
 		log.Printf("Warning: Adding student %s to non-existent class %s. Creating class.", student.ID, student.ClassID)
 		// Optionally auto-create class
-		err := s.AddClass(models.Clazz{ID: student.ClassID, Name: "Class " + student.ClassID})
-		if err != nil {
+		err := s.AddClass(ctx, models.Clazz{ID: student.ClassID, Name: "Class " + student.ClassID})
+		if err != nil && !errors.Is(err, ErrClassAlreadyExists) { // Created concurrently is fine
 			log.Printf("Failed to auto-create class %s: %v", student.ClassID, err)
 			return fmt.Errorf("student's class %s does not exist and auto-creation failed: %w", student.ClassID, err)
 		}
 	}
 
-	studentKey := getStudentInfoKey(student.ID)
-	classStudentsKey := getClassStudentsKey(student.ClassID)
-
-	pipe := s.Client.Pipeline()
-	// Add student ID to the class's set of students
-	pipe.SAdd(s.Ctx, classStudentsKey, student.ID)
-	// Store student details in a Hash
-	pipe.HMSet(s.Ctx, studentKey, map[string]interface{}{
-		"id":      student.ID,
-		"name":    student.Name,
-		"classId": student.ClassID,
-	})
-
-	_, execErr := pipe.Exec(s.Ctx)
-	if execErr != nil {
-		log.Printf("Error adding student %s to class %s: %v", student.ID, student.ClassID, execErr)
-		return fmt.Errorf("failed to add student to Redis: %w", execErr)
+	// The existence check and the write happen in one script so concurrent adds of the same ID can't both succeed
+	added, err := addStudentScript.Run(ctx, s.Client,
+		[]string{getStudentInfoKey(student.ID), getClassStudentsKey(student.ClassID)},
+		student.ID, student.Name, student.ClassID,
+	).Int64()
+	if err != nil {
+		log.Printf("Error adding student %s to class %s: %v", student.ID, student.ClassID, err)
+		return fmt.Errorf("failed to add student to Redis: %w", err)
+	}
+	if added == 0 {
+		return ErrStudentAlreadyExists
 	}
 	// log.Printf("Added student: %s (%s) to class %s", student.Name, student.ID, student.ClassID) // Can be noisy
 	return nil
 }
 
+// AddStudents adds a batch of students with a fixed number of round trips regardless of batch size.
+// Each distinct class is checked (and auto-created, like AddStudent) once up front, then the current class of
+// every student is read in one pipeline and all writes are queued in one MULTI/EXEC transaction.
+// Unlike AddStudent, existing students are overwritten so a roster can be re-imported; a student that
+// currently belongs to another class is moved, never listed under both.
+// Redis does not roll back MULTI/EXEC when a single command fails, and a connection error after EXEC was
+// sent leaves the outcome unknown, so if an error is returned the batch may be partially applied.
+// Retrying the whole batch is safe because every write is idempotent.
+func (s *RedisService) AddStudents(ctx context.Context, students []models.Student) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if len(students) == 0 {
+		return nil
+	}
+
+	checkedClasses := make(map[string]bool)
+	for _, student := range students {
+		if student.ID == "" || student.Name == "" || student.ClassID == "" {
+			return fmt.Errorf("student ID, Name, and ClassID cannot be empty (student ID: '%s')", student.ID)
+		}
+		if checkedClasses[student.ClassID] {
+			continue
+		}
+		exists, err := s.ClassExists(ctx, student.ClassID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			log.Printf("Warning: Adding students to non-existent class %s. Creating class.", student.ClassID)
+			err := s.AddClass(ctx, models.Clazz{ID: student.ClassID, Name: "Class " + student.ClassID})
+			if err != nil && !errors.Is(err, ErrClassAlreadyExists) { // Created concurrently is fine
+				log.Printf("Failed to auto-create class %s: %v", student.ClassID, err)
+				return fmt.Errorf("students' class %s does not exist and auto-creation failed: %w", student.ClassID, err)
+			}
+		}
+		checkedClasses[student.ClassID] = true
+	}
+
+	studentKeys := make([]string, 0, len(students))
+	for _, student := range students {
+		studentKeys = append(studentKeys, getStudentInfoKey(student.ID))
+	}
+
+	// WATCH the student hashes so a concurrent move can't slip in between reading and rewriting them
+	err := s.watchWithRetry(ctx, func(tx *redis.Tx) error {
+		// Find each student's current class, if any, in one round trip
+		currentClasses := make([]*redis.StringCmd, len(students))
+		_, err := tx.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range studentKeys {
+				currentClasses[i] = pipe.HGet(ctx, key, "classId")
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		// Pipelined only reports the first failure, usually redis.Nil for a new student, so check every command
+		for i, cmd := range currentClasses {
+			if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+				return fmt.Errorf("failed to read current class of student %s: %w", students[i].ID, err)
+			}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, student := range students {
+				if currentClassID := currentClasses[i].Val(); currentClassID != "" && currentClassID != student.ClassID {
+					// Existing student in another class: unlink it there so it is only listed under the new class
+					pipe.SRem(ctx, getClassStudentsKey(currentClassID), student.ID)
+					pipe.SRem(ctx, getClassCalledKey(currentClassID), student.ID)
+				}
+				pipe.SAdd(ctx, getClassStudentsKey(student.ClassID), student.ID)
+				pipe.HMSet(ctx, studentKeys[i], map[string]interface{}{
+					"id":      student.ID,
+					"name":    student.Name,
+					"classId": student.ClassID,
+				})
+			}
+			return nil
+		})
+		return err
+	}, studentKeys...)
+	if err != nil {
+		log.Printf("Error adding batch of %d students: %v", len(students), err)
+		return fmt.Errorf("failed to add students to Redis, batch may be partially applied: %w", err)
+	}
+	return nil
+}
+
 // GetStudentByID retrieves a student by their ID
-func (s *RedisService) GetStudentByID(studentID string) (*models.Student, error) {
+func (s *RedisService) GetStudentByID(ctx context.Context, studentID string) (*models.Student, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	studentKey := getStudentInfoKey(studentID)
-	data, err := s.Client.HGetAll(s.Ctx, studentKey).Result()
+	data, err := s.Client.HGetAll(ctx, studentKey).Result()
 
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
@@ -200,10 +465,110 @@ func (s *RedisService) GetStudentByID(studentID string) (*models.Student, error)
 	}, nil
 }
 
+// UpdateStudent rewrites an existing student's details, moving it between classes if ClassID changed.
+// Returns ErrStudentNotFound if the student does not exist, or ErrClassNotFound if the target class
+// does not exist (unlike AddStudent, the class is not auto-created).
+func (s *RedisService) UpdateStudent(ctx context.Context, student models.Student) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if student.ID == "" || student.Name == "" || student.ClassID == "" {
+		return errors.New("student ID, Name, and ClassID cannot be empty")
+	}
+
+	studentKey := getStudentInfoKey(student.ID)
+	// WATCH the student hash so two concurrent moves can't both act on a stale old class, and the classes
+	// set so the target class can't be deleted between the check and the write
+	err := s.watchWithRetry(ctx, func(tx *redis.Tx) error {
+		currentClassID, err := tx.HGet(ctx, studentKey, "classId").Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return ErrStudentNotFound
+			}
+			return err
+		}
+		exists, err := tx.SIsMember(ctx, classesKey, student.ClassID).Result()
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrClassNotFound
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if currentClassID != student.ClassID {
+				// Move the student ID between class sets atomically so it is never listed under two classes
+				pipe.SRem(ctx, getClassStudentsKey(currentClassID), student.ID)
+				pipe.SRem(ctx, getClassCalledKey(currentClassID), student.ID)
+				pipe.SAdd(ctx, getClassStudentsKey(student.ClassID), student.ID)
+			}
+			pipe.HMSet(ctx, studentKey, map[string]interface{}{
+				"id":      student.ID,
+				"name":    student.Name,
+				"classId": student.ClassID,
+			})
+			return nil
+		})
+		return err
+	}, studentKey, classesKey)
+	if err != nil {
+		if errors.Is(err, ErrStudentNotFound) || errors.Is(err, ErrClassNotFound) {
+			return err
+		}
+		log.Printf("Error updating student %s: %v", student.ID, err)
+		return fmt.Errorf("failed to update student in Redis: %w", err)
+	}
+	log.Printf("Updated student: %s (%s) in class %s", student.Name, student.ID, student.ClassID)
+	return nil
+}
+
+// DeleteStudent removes a student and unlinks it from its class.
+// Returns ErrStudentNotFound if the student does not exist.
+func (s *RedisService) DeleteStudent(ctx context.Context, studentID string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	studentKey := getStudentInfoKey(studentID)
+	var classID string
+	// WATCH the student hash so a concurrent class move can't leave the ID behind in its new class
+	err := s.watchWithRetry(ctx, func(tx *redis.Tx) error {
+		var err error
+		classID, err = tx.HGet(ctx, studentKey, "classId").Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return ErrStudentNotFound
+			}
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			// Remove student details
+			pipe.Del(ctx, studentKey)
+			// Remove student ID from the class's set of students and roll call state
+			pipe.SRem(ctx, getClassStudentsKey(classID), studentID)
+			pipe.SRem(ctx, getClassCalledKey(classID), studentID)
+			return nil
+		})
+		return err
+	}, studentKey)
+	if err != nil {
+		if errors.Is(err, ErrStudentNotFound) {
+			return err
+		}
+		log.Printf("Error deleting student %s: %v", studentID, err)
+		return fmt.Errorf("failed to delete student from Redis: %w", err)
+	}
+	log.Printf("Deleted student %s from class %s", studentID, classID)
+	return nil
+}
+
 // GetStudentsByClassID retrieves all students for a given class ID
-func (s *RedisService) GetStudentsByClassID(classID string) ([]models.Student, error) {
+func (s *RedisService) GetStudentsByClassID(ctx context.Context, classID string) ([]models.Student, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	classStudentsKey := getClassStudentsKey(classID)
-	studentIDs, err := s.Client.SMembers(s.Ctx, classStudentsKey).Result()
+	studentIDs, err := s.Client.SMembers(ctx, classStudentsKey).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			return []models.Student{}, nil // No students in this class
@@ -214,7 +579,7 @@ func (s *RedisService) GetStudentsByClassID(classID string) ([]models.Student, e
 
 	students := make([]models.Student, 0, len(studentIDs))
 	for _, id := range studentIDs {
-		student, err := s.GetStudentByID(id)
+		student, err := s.GetStudentByID(ctx, id)
 		if err != nil {
 			log.Printf("Error fetching details for student %s in class %s: %v", id, classID, err)
 			continue // Skip this student if details can't be fetched
@@ -226,12 +591,103 @@ func (s *RedisService) GetStudentsByClassID(classID string) ([]models.Student, e
 	return students, nil
 }
 
+// GetStudentsByClassPaged returns one page of a class's students sorted by ID, optionally filtered
+// by a case-insensitive name substring. It also returns the total number of matching students.
+func (s *RedisService) GetStudentsByClassPaged(ctx context.Context, classID string, offset, limit int, nameFilter string) ([]models.Student, int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	studentIDs, err := s.Client.SMembers(ctx, getClassStudentsKey(classID)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("Error getting student IDs for class %s: %v", classID, err)
+		return nil, 0, fmt.Errorf("failed to get student IDs from Redis for class %s: %w", classID, err)
+	}
+	// SMEMBERS order is effectively random, sort so pages are stable
+	sort.Strings(studentIDs)
+
+	if nameFilter == "" {
+		// Only the requested page needs to be loaded
+		total := len(studentIDs)
+		if offset >= total {
+			return []models.Student{}, total, nil
+		}
+		end := offset + limit
+		if end > total {
+			end = total
+		}
+		students, err := s.getStudentsByIDs(ctx, studentIDs[offset:end])
+		if err != nil {
+			return nil, 0, err
+		}
+		return students, total, nil
+	}
+
+	// Filtering by name needs every student's details
+	students, err := s.getStudentsByIDs(ctx, studentIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+	needle := strings.ToLower(nameFilter)
+	matched := students[:0]
+	for _, student := range students {
+		if strings.Contains(strings.ToLower(student.Name), needle) {
+			matched = append(matched, student)
+		}
+	}
+
+	total := len(matched)
+	if offset >= total {
+		return []models.Student{}, total, nil
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return matched[offset:end], total, nil
+}
+
+// getStudentsByIDs loads the given students in one pipeline, preserving order and skipping IDs without details
+func (s *RedisService) getStudentsByIDs(ctx context.Context, studentIDs []string) ([]models.Student, error) {
+	if len(studentIDs) == 0 {
+		return []models.Student{}, nil
+	}
+
+	cmds := make([]*redis.StringStringMapCmd, len(studentIDs))
+	_, err := s.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range studentIDs {
+			cmds[i] = pipe.HGetAll(ctx, getStudentInfoKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error getting details for %d students: %v", len(studentIDs), err)
+		return nil, fmt.Errorf("failed to get students from Redis: %w", err)
+	}
+
+	students := make([]models.Student, 0, len(studentIDs))
+	for _, cmd := range cmds {
+		data := cmd.Val()
+		if len(data) == 0 {
+			continue // Not found
+		}
+		students = append(students, models.Student{
+			ID:      data["id"],
+			Name:    data["name"],
+			ClassID: data["classId"],
+		})
+	}
+	return students, nil
+}
+
 // GetRandomStudent selects a random student from a class
-func (s *RedisService) GetRandomStudent(classID string) (*models.Student, error) {
+func (s *RedisService) GetRandomStudent(ctx context.Context, classID string) (*models.Student, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	classStudentsKey := getClassStudentsKey(classID)
 
 	// Use SRANDMEMBER to get one random member ID
-	randomStudentID, err := s.Client.SRandMember(s.Ctx, classStudentsKey).Result()
+	randomStudentID, err := s.Client.SRandMember(ctx, classStudentsKey).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			return nil, nil // Class exists but has no students, or key doesn't exist
@@ -245,56 +701,270 @@ func (s *RedisService) GetRandomStudent(classID string) (*models.Student, error)
 	}
 
 	// Fetch the details of the randomly selected student
-	return s.GetStudentByID(randomStudentID)
+	student, err := s.GetStudentByID(ctx, randomStudentID)
+	if err != nil || student == nil {
+		return student, err
+	}
+	s.recordPicks(ctx, classID, student.ID)
+	return student, nil
 }
 
-// --- Excel Import ---
+// GetRandomStudents selects up to count distinct random students from a class.
+// If count exceeds the class size, all students are returned.
+func (s *RedisService) GetRandomStudents(ctx context.Context, classID string, count int) ([]models.Student, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-// ImportStudentsFromExcel reads an Excel file stream and adds students to the specified class
-func (s *RedisService) ImportStudentsFromExcel(file io.Reader, classID string) (int, error) {
-	// 1. Check if class exists (or create it)
-	exists, err := s.ClassExists(classID)
+	if count < 1 {
+		return nil, errors.New("count must be a positive integer")
+	}
+	classStudentsKey := getClassStudentsKey(classID)
+
+	// A positive count makes SRANDMEMBER return distinct members, capped at the set size
+	studentIDs, err := s.Client.SRandMemberN(ctx, classStudentsKey, int64(count)).Result()
 	if err != nil {
-		return 0, fmt.Errorf("failed to check class existence before import: %w", err)
+		if errors.Is(err, redis.Nil) {
+			return []models.Student{}, nil
+		}
+		log.Printf("Error getting %d random student IDs for class %s: %v", count, classID, err)
+		return nil, fmt.Errorf("failed to get random student IDs from Redis for class %s: %w", classID, err)
 	}
-	if !exists {
-		log.Printf("Import target class %s does not exist. Creating it.", classID)
-		err := s.AddClass(models.Clazz{ID: classID, Name: "Imported Class " + classID})
+
+	students := make([]models.Student, 0, len(studentIDs))
+	for _, id := range studentIDs {
+		student, err := s.GetStudentByID(ctx, id)
 		if err != nil {
-			return 0, fmt.Errorf("target class %s does not exist and failed to create it: %w", classID, err)
+			return nil, err
+		}
+		if student != nil {
+			students = append(students, *student)
 		}
 	}
 
-	f, err := excelize.OpenReader(file)
+	pickedIDs := make([]string, 0, len(students))
+	for _, student := range students {
+		pickedIDs = append(pickedIDs, student.ID)
+	}
+	s.recordPicks(ctx, classID, pickedIDs...)
+	return students, nil
+}
+
+// noRepeatPickScript picks a student not yet called in the current round and records it in one atomic step,
+// so concurrent no-repeat picks can never return the same student.
+// KEYS[1] = class students set, KEYS[2] = class called set, ARGV[1] = random non-negative integer.
+// Returns {studentId, remaining} or nil if the class has no students.
+var noRepeatPickScript = redis.NewScript(`
+local remaining = redis.call('SDIFF', KEYS[1], KEYS[2])
+if #remaining == 0 then
+	-- Round complete (or stale called entries), start a fresh round from the full roster
+	redis.call('DEL', KEYS[2])
+	remaining = redis.call('SMEMBERS', KEYS[1])
+	if #remaining == 0 then
+		return false
+	end
+end
+local picked = remaining[(tonumber(ARGV[1]) % #remaining) + 1]
+local left = #remaining - 1
+if left == 0 then
+	-- Everyone has been called, clear the set so the next pick starts a new round
+	redis.call('DEL', KEYS[2])
+else
+	redis.call('SADD', KEYS[2], picked)
+end
+return {picked, left}
+`)
+
+// GetRandomStudentNoRepeat selects a random student that has not yet been picked in the current round.
+// Picked IDs are recorded in class:{id}:called; once every student has been picked the set is cleared
+// and a new round starts. It also returns how many students remain to be picked in the current round.
+func (s *RedisService) GetRandomStudentNoRepeat(ctx context.Context, classID string) (*models.Student, int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	// The random index comes from the client so the script itself stays deterministic
+	res, err := noRepeatPickScript.Run(ctx, s.Client,
+		[]string{getClassStudentsKey(classID), getClassCalledKey(classID)},
+		rand.Int31(),
+	).Result()
 	if err != nil {
-		log.Printf("Error opening Excel reader: %v", err)
-		return 0, fmt.Errorf("failed to open excel file: %w", err)
+		if errors.Is(err, redis.Nil) {
+			return nil, 0, nil // Class has no students
+		}
+		log.Printf("Error picking no-repeat student for class %s: %v", classID, err)
+		return nil, 0, fmt.Errorf("failed to pick no-repeat student from Redis for class %s: %w", classID, err)
 	}
-	defer func() {
-		// Close the spreadsheet.
-		if err := f.Close(); err != nil {
-			log.Printf("Error closing excel file: %v", err)
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 2 {
+		return nil, 0, fmt.Errorf("unexpected no-repeat pick result for class %s: %v", classID, res)
+	}
+	pickedID, _ := values[0].(string)
+	remaining, _ := values[1].(int64)
+
+	student, err := s.GetStudentByID(ctx, pickedID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if student != nil {
+		s.recordPicks(ctx, classID, student.ID)
+	}
+	return student, int(remaining), nil
+}
+
+// ResetRollcall clears the set of students already picked in the current no-repeat round
+func (s *RedisService) ResetRollcall(ctx context.Context, classID string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err := s.Client.Del(ctx, getClassCalledKey(classID)).Err()
+	if err != nil {
+		log.Printf("Error resetting roll call for class %s: %v", classID, err)
+		return fmt.Errorf("failed to reset roll call in Redis for class %s: %w", classID, err)
+	}
+	return nil
+}
+
+// --- Roll Call History ---
+
+// recordPicks appends picked students to the class history. Failures are logged rather than returned
+// so a history write problem never fails the pick itself.
+func (s *RedisService) recordPicks(ctx context.Context, classID string, studentIDs ...string) {
+	if len(studentIDs) == 0 {
+		return
+	}
+	now := time.Now()
+	members := make([]*redis.Z, 0, len(studentIDs))
+	for _, id := range studentIDs {
+		// Members must be unique per pick, otherwise picking the same student again would overwrite the old entry
+		members = append(members, &redis.Z{
+			Score:  float64(now.UnixMilli()), // Milliseconds are exact in a float64
+			Member: id + ":" + strconv.FormatInt(now.UnixNano(), 10),
+		})
+	}
+	if err := s.Client.ZAdd(ctx, getClassHistoryKey(classID), members...).Err(); err != nil {
+		log.Printf("Error recording roll call history for class %s: %v", classID, err)
+	}
+}
+
+// GetRollcallHistory returns the picks for a class made at or after since, oldest first.
+// A zero since returns the full history.
+func (s *RedisService) GetRollcallHistory(ctx context.Context, classID string, since time.Time) ([]models.HistoryEntry, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	minScore := "-inf"
+	if !since.IsZero() {
+		minScore = strconv.FormatInt(since.UnixMilli(), 10)
+	}
+	picks, err := s.Client.ZRangeByScoreWithScores(ctx, getClassHistoryKey(classID), &redis.ZRangeBy{
+		Min: minScore,
+		Max: "+inf",
+	}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("Error getting roll call history for class %s: %v", classID, err)
+		return nil, fmt.Errorf("failed to get roll call history from Redis for class %s: %w", classID, err)
+	}
+
+	names := make(map[string]string) // Student ID -> name, avoids refetching frequently picked students
+	entries := make([]models.HistoryEntry, 0, len(picks))
+	for _, pick := range picks {
+		member, ok := pick.Member.(string)
+		if !ok {
+			continue
+		}
+		studentID := member
+		if i := strings.LastIndex(member, ":"); i >= 0 {
+			studentID = member[:i]
 		}
-	}()
 
-	// Assuming data is in the first sheet
-	sheetName := f.GetSheetName(0) // Or f.GetSheetList()[0]
-	if sheetName == "" {
-		return 0, errors.New("excel file does not contain any sheets")
+		name, cached := names[studentID]
+		if !cached {
+			student, err := s.GetStudentByID(ctx, studentID)
+			if err != nil {
+				return nil, err
+			}
+			if student != nil {
+				name = student.Name
+			}
+			names[studentID] = name
+		}
+
+		entries = append(entries, models.HistoryEntry{
+			StudentID: studentID,
+			Name:      name,
+			PickedAt:  time.UnixMilli(int64(pick.Score)),
+		})
 	}
+	return entries, nil
+}
 
-	rows, err := f.GetRows(sheetName)
+// GetPickCounts returns how many times each current student of a class appears in entries (as returned by
+// GetRollcallHistory), including students that were never picked, sorted by count (least picked first) then ID.
+func (s *RedisService) GetPickCounts(ctx context.Context, classID string, entries []models.HistoryEntry) ([]models.PickCount, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	students, err := s.GetStudentsByClassID(ctx, classID)
 	if err != nil {
-		log.Printf("Error getting rows from sheet '%s': %v", sheetName, err)
-		return 0, fmt.Errorf("failed to get rows from sheet %s: %w", sheetName, err)
+		return nil, err
+	}
+
+	picked := make(map[string]int)
+	for _, entry := range entries {
+		picked[entry.StudentID]++
 	}
 
-	importedCount := 0
-	// Use a pipeline for potentially faster bulk inserts
-	// pipe := s.Client.Pipeline()
+	counts := make([]models.PickCount, 0, len(students))
+	for _, student := range students {
+		counts = append(counts, models.PickCount{
+			StudentID: student.ID,
+			Name:      student.Name,
+			Count:     picked[student.ID],
+		})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count < counts[j].Count
+		}
+		return counts[i].StudentID < counts[j].StudentID
+	})
+	return counts, nil
+}
+
+// --- Student Import ---
+
+// importRow is one spreadsheet row along with its 1-based row number as the user sees it
+type importRow struct {
+	number int
+	cells  []string
+}
+
+// ensureImportClass checks that the import target class exists, creating it if needed
+func (s *RedisService) ensureImportClass(ctx context.Context, classID string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	exists, err := s.ClassExists(ctx, classID)
+	if err != nil {
+		return fmt.Errorf("failed to check class existence before import: %w", err)
+	}
+	if !exists {
+		log.Printf("Import target class %s does not exist. Creating it.", classID)
+		err := s.AddClass(ctx, models.Clazz{ID: classID, Name: "Imported Class " + classID})
+		if err != nil && !errors.Is(err, ErrClassAlreadyExists) { // Created concurrently is fine
+			return fmt.Errorf("target class %s does not exist and failed to create it: %w", classID, err)
+		}
+	}
+	return nil
+}
+
+// importStudentRows validates parsed rows and adds the valid ones to the class in one batch.
+// The first row is treated as the header; column 0 is the student ID and column 1 the name.
+func (s *RedisService) importStudentRows(ctx context.Context, rows []importRow, classID string, source string) (models.ImportResult, error) {
+	result := models.ImportResult{SkippedRows: []models.RowError{}}
 	studentsToAdd := []models.Student{}
+	studentRows := []int{}          // Row number of each entry in studentsToAdd
+	seenIDs := make(map[string]int) // Student ID -> row it was first seen on
 
-	// Start from row 1 (index 1) to skip header (assuming row 0 is header)
 	for i, row := range rows {
 		if i == 0 {
 			continue // Skip header row
@@ -303,86 +973,261 @@ func (s *RedisService) ImportStudentsFromExcel(file io.Reader, classID string) (
 		var studentID, studentName string
 
 		// Assuming Column A (index 0) is Student ID, Column B (index 1) is Name
-		if len(row) > 0 {
-			studentID = row[0]
+		if len(row.cells) > 0 {
+			studentID = row.cells[0]
 		}
-		if len(row) > 1 {
-			studentName = row[1]
+		if len(row.cells) > 1 {
+			studentName = row.cells[1]
+		}
+
+		// Blank rows are not rejections, just ignore them
+		if studentID == "" && studentName == "" {
+			continue
 		}
 
 		// Basic validation
-		if studentID == "" || studentName == "" {
-			log.Printf("Skipping row %d due to missing ID or Name (ID: '%s', Name: '%s')", i+1, studentID, studentName)
+		if studentID == "" {
+			log.Printf("Skipping row %d due to missing ID (Name: '%s')", row.number, studentName)
+			result.SkippedRows = append(result.SkippedRows, models.RowError{Row: row.number, Reason: "missing ID"})
+			continue
+		}
+		if studentName == "" {
+			log.Printf("Skipping row %d due to missing Name (ID: '%s')", row.number, studentID)
+			result.SkippedRows = append(result.SkippedRows, models.RowError{Row: row.number, Reason: "missing name"})
 			continue
 		}
 
+		if firstRow, seen := seenIDs[studentID]; seen {
+			log.Printf("Skipping row %d due to duplicate ID '%s' (first seen on row %d)", row.number, studentID, firstRow)
+			result.SkippedRows = append(result.SkippedRows, models.RowError{Row: row.number, Reason: "duplicate ID"})
+			continue
+		}
+		seenIDs[studentID] = row.number
+
 		student := models.Student{
 			ID:      studentID, // Consider prefixing with classID if IDs aren't globally unique: classID + "_" + studentID
 			Name:    studentName,
 			ClassID: classID,
 		}
 		studentsToAdd = append(studentsToAdd, student)
+		studentRows = append(studentRows, row.number)
+	}
+
+	// Add all valid students in one batch instead of a round trip per student
+	log.Printf("Attempting to add %d students from %s file to class %s", len(studentsToAdd), source, classID)
+	if err := s.AddStudents(ctx, studentsToAdd); err != nil {
+		// Keep the continue-on-error behavior: report the rows instead of failing the whole import
+		log.Printf("Error adding students during import into class %s: %v", classID, err)
+		for _, rowNumber := range studentRows {
+			result.SkippedRows = append(result.SkippedRows, models.RowError{Row: rowNumber, Reason: "redis add failed"})
+		}
+		sort.Slice(result.SkippedRows, func(i, j int) bool { return result.SkippedRows[i].Row < result.SkippedRows[j].Row })
+	} else {
+		result.ImportedCount = len(studentsToAdd)
+	}
+
+	log.Printf("Successfully imported %d students into class %s (%d rows skipped)", result.ImportedCount, classID, len(result.SkippedRows))
+	return result, nil
+}
+
+// ImportStudentsFromExcel reads an Excel file stream and adds students to the specified class.
+// Invalid rows are skipped and reported in the result rather than aborting the import.
+func (s *RedisService) ImportStudentsFromExcel(ctx context.Context, file io.Reader, classID string) (models.ImportResult, error) {
+	// No overall timeout: parsing a large file must not eat into the Redis budget,
+	// so ensureImportClass and AddStudents each apply their own
+
+	// 1. Check if class exists (or create it)
+	if err := s.ensureImportClass(ctx, classID); err != nil {
+		return models.ImportResult{}, err
 	}
 
-	// Add students using the service's AddStudent method (which uses pipeline internally)
-	// Or, optimize further by building a larger pipeline here if AddStudent doesn't already
-	log.Printf("Attempting to add %d students from Excel file to class %s", len(studentsToAdd), classID)
-	for _, student := range studentsToAdd {
-		err := s.AddStudent(student) // Calls the existing AddStudent logic
+	f, err := excelize.OpenReader(file)
+	if err != nil {
+		log.Printf("Error opening Excel reader: %v", err)
+		return models.ImportResult{}, fmt.Errorf("failed to open excel file: %w", err)
+	}
+	defer func() {
+		// Close the spreadsheet.
+		if err := f.Close(); err != nil {
+			log.Printf("Error closing excel file: %v", err)
+		}
+	}()
+
+	// Assuming data is in the first sheet
+	sheetName := f.GetSheetName(0) // Or f.GetSheetList()[0]
+	if sheetName == "" {
+		return models.ImportResult{}, errors.New("excel file does not contain any sheets")
+	}
+
+	rows, err := f.GetRows(sheetName)
+	if err != nil {
+		log.Printf("Error getting rows from sheet '%s': %v", sheetName, err)
+		return models.ImportResult{}, fmt.Errorf("failed to get rows from sheet %s: %w", sheetName, err)
+	}
+
+	importRows := make([]importRow, 0, len(rows))
+	for i, row := range rows {
+		importRows = append(importRows, importRow{number: i + 1, cells: row}) // Excel rows are 1-based
+	}
+	return s.importStudentRows(ctx, importRows, classID, "Excel")
+}
+
+// ImportStudentsFromCSV reads a CSV file stream and adds students to the specified class.
+// It follows the same layout and conventions as ImportStudentsFromExcel; a leading UTF-8 BOM is ignored.
+func (s *RedisService) ImportStudentsFromCSV(ctx context.Context, file io.Reader, classID string) (models.ImportResult, error) {
+	// Timeouts are applied per Redis call, as in ImportStudentsFromExcel
+
+	// 1. Check if class exists (or create it)
+	if err := s.ensureImportClass(ctx, classID); err != nil {
+		return models.ImportResult{}, err
+	}
+
+	// Excel-exported CSVs often start with a BOM, which would otherwise end up in the header
+	br := bufio.NewReader(file)
+	if bom, err := br.Peek(3); err == nil && bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		_, _ = br.Discard(3)
+	}
+
+	r := csv.NewReader(br)
+	r.FieldsPerRecord = -1 // Rows may have a varying number of columns
+
+	importRows := []importRow{}
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Printf("Error reading CSV file: %v", err)
+			return models.ImportResult{}, fmt.Errorf("failed to read csv file: %w", err)
+		}
+		// The CSV reader skips blank lines, so use the source line to keep row numbers accurate
+		line, _ := r.FieldPos(0)
+		importRows = append(importRows, importRow{number: line, cells: record})
+	}
+	return s.importStudentRows(ctx, importRows, classID, "CSV")
+}
+
+// --- Excel Export ---
+
+// ExportStudentsToExcel writes the students of a class to an Excel file in the same format
+// ImportStudentsFromExcel expects (header row "ID","Name", then one row per student), so the
+// result can be re-imported without modification. Returns ErrClassNotFound if the class does not exist.
+func (s *RedisService) ExportStudentsToExcel(ctx context.Context, classID string) (io.Reader, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	exists, err := s.ClassExists(ctx, classID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrClassNotFound
+	}
+
+	students, err := s.GetStudentsByClassID(ctx, classID)
+	if err != nil {
+		return nil, err
+	}
+	// Stable output order, SMEMBERS order is effectively random
+	sort.Slice(students, func(i, j int) bool { return students[i].ID < students[j].ID })
+
+	f := excelize.NewFile()
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Printf("Error closing excel file: %v", err)
+		}
+	}()
+
+	sheetName := f.GetSheetName(0)
+	if err := f.SetSheetRow(sheetName, "A1", &[]interface{}{"ID", "Name"}); err != nil {
+		return nil, fmt.Errorf("failed to write header row: %w", err)
+	}
+	for i, student := range students {
+		cell, err := excelize.CoordinatesToCellName(1, i+2) // Row 1 is the header
 		if err != nil {
-			log.Printf("Error adding student %s (%s) during import: %v", student.Name, student.ID, err)
-			// Decide whether to stop import on first error or continue
-			// return importedCount, fmt.Errorf("error adding student %s: %w", student.ID, err) // Stop on error
-			continue // Continue processing other students
+			return nil, fmt.Errorf("failed to compute cell for row %d: %w", i+2, err)
+		}
+		if err := f.SetSheetRow(sheetName, cell, &[]interface{}{student.ID, student.Name}); err != nil {
+			return nil, fmt.Errorf("failed to write row for student %s: %w", student.ID, err)
 		}
-		importedCount++
 	}
 
-	log.Printf("Successfully imported %d students into class %s", importedCount, classID)
-	return importedCount, nil
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		log.Printf("Error writing excel file for class %s: %v", classID, err)
+		return nil, fmt.Errorf("failed to write excel file: %w", err)
+	}
+	log.Printf("Exported %d students from class %s", len(students), classID)
+	return &buf, nil
 }
 
 // --- Seed Data (Optional) ---
-func (s *RedisService) SeedData() {
+func (s *RedisService) SeedData(ctx context.Context) {
 	log.Println("Seeding initial data...")
 
-	// Optional: Flush DB 5 before seeding (Use with caution!)
-	// if err := s.Client.FlushDB(s.Ctx).Err(); err != nil {
+	// Optional: Flush DB before seeding (Use with caution!)
+	// if err := s.Client.FlushDB(ctx).Err(); err != nil {
 	//  log.Fatalf("Failed to flush DB: %v", err)
 	// }
 
 	class1 := models.Clazz{ID: "C2024_GO01", Name: "2024 Go Backend Class 1"}
 	class2 := models.Clazz{ID: "C2024_PY02", Name: "2024 Python Data Science 2"}
 
-	_ = s.AddClass(class1)
-	_ = s.AddClass(class2)
+	_ = s.AddClass(ctx, class1)
+	_ = s.AddClass(ctx, class2)
 
-	_ = s.AddStudent(models.Student{ID: "S_GO01_001", Name: "Alice", ClassID: class1.ID})
-	_ = s.AddStudent(models.Student{ID: "S_GO01_002", Name: "Bob", ClassID: class1.ID})
-	_ = s.AddStudent(models.Student{ID: "S_GO01_003", Name: "Charlie", ClassID: class1.ID})
+	_ = s.AddStudent(ctx, models.Student{ID: "S_GO01_001", Name: "Alice", ClassID: class1.ID})
+	_ = s.AddStudent(ctx, models.Student{ID: "S_GO01_002", Name: "Bob", ClassID: class1.ID})
+	_ = s.AddStudent(ctx, models.Student{ID: "S_GO01_003", Name: "Charlie", ClassID: class1.ID})
 
-	_ = s.AddStudent(models.Student{ID: "S_PY02_001", Name: "David", ClassID: class2.ID})
-	_ = s.AddStudent(models.Student{ID: "S_PY02_002", Name: "Eve", ClassID: class2.ID})
+	_ = s.AddStudent(ctx, models.Student{ID: "S_PY02_001", Name: "David", ClassID: class2.ID})
+	_ = s.AddStudent(ctx, models.Student{ID: "S_PY02_002", Name: "Eve", ClassID: class2.ID})
 
 	log.Println("Seeding complete.")
 }
 
 // --- Utility ---
 
-// InitializeRedisClient creates and tests a Redis client connection
+// Ping checks Redis connectivity
+func (s *RedisService) Ping(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.Client.Ping(ctx).Err()
+}
+
+// getEnv returns the value of an environment variable, or fallback if it is unset or empty
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// InitializeRedisClient creates and tests a Redis client connection.
+// Connection settings come from REDIS_ADDR, REDIS_PASSWORD and REDIS_DB, defaulting to 127.0.0.1:6379, no password, DB 8.
 func InitializeRedisClient() *redis.Client {
+	addr := getEnv("REDIS_ADDR", "127.0.0.1:6379")
+	password := getEnv("REDIS_PASSWORD", "")
+	dbStr := getEnv("REDIS_DB", "8")
+	dbIndex, err := strconv.Atoi(dbStr)
+	if err != nil {
+		log.Fatalf("Invalid REDIS_DB value %q: must be an integer", dbStr)
+	}
+
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     "127.0.0.1:6379", // Redis server address
-		Password: "",               // No password set
-		DB:       8,                // Use database 5
+		Addr:     addr,     // Redis server address
+		Password: password, // Empty means no password
+		DB:       dbIndex,  // Redis database index
 	})
 
 	// Ping Redis to check connection
-	_, err := rdb.Ping(context.Background()).Result()
+	_, err = rdb.Ping(context.Background()).Result()
 	if err != nil {
-		log.Fatalf("Could not connect to Redis: %v", err)
+		log.Fatalf("Could not connect to Redis at %s: %v", addr, err)
 	}
 
-	log.Println("Successfully connected to Redis DB 5")
+	log.Printf("Successfully connected to Redis at %s DB %d", addr, dbIndex)
 	return rdb
 }
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"rollcall-server-go/models"
+)
+
+const benchStudentCount = 500
+
+// roundTripCounter is a go-redis hook counting network round trips (single commands and whole pipelines)
+type roundTripCounter struct {
+	n int64
+}
+
+func (c *roundTripCounter) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	atomic.AddInt64(&c.n, 1)
+	return ctx, nil
+}
+
+func (c *roundTripCounter) AfterProcess(context.Context, redis.Cmder) error { return nil }
+
+func (c *roundTripCounter) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	atomic.AddInt64(&c.n, 1)
+	return ctx, nil
+}
+
+func (c *roundTripCounter) AfterProcessPipeline(context.Context, []redis.Cmder) error { return nil }
+
+func benchStudents() []models.Student {
+	students := make([]models.Student, 0, benchStudentCount)
+	for i := 0; i < benchStudentCount; i++ {
+		students = append(students, models.Student{
+			ID:      fmt.Sprintf("S_BENCH_%03d", i),
+			Name:    fmt.Sprintf("Student %d", i),
+			ClassID: "C_BENCH",
+		})
+	}
+	return students
+}
+
+// runAddBenchmark runs add against an empty database each iteration and reports round trips per import
+func runAddBenchmark(b *testing.B, add func(ctx context.Context, s *RedisService, students []models.Student) error) {
+	s, mr := newTestService(b)
+	counter := &roundTripCounter{}
+	s.Client.AddHook(counter)
+	ctx := context.Background()
+	students := benchStudents()
+
+	var roundTrips int64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		mr.FlushAll()
+		atomic.StoreInt64(&counter.n, 0)
+		b.StartTimer()
+
+		if err := add(ctx, s, students); err != nil {
+			b.Fatalf("add failed: %v", err)
+		}
+		roundTrips += atomic.LoadInt64(&counter.n)
+	}
+	b.ReportMetric(float64(roundTrips)/float64(b.N), "roundtrips/op")
+}
+
+func BenchmarkAddStudents(b *testing.B) {
+	runAddBenchmark(b, func(ctx context.Context, s *RedisService, students []models.Student) error {
+		return s.AddStudents(ctx, students)
+	})
+}
+
+func BenchmarkAddStudentLoop(b *testing.B) {
+	runAddBenchmark(b, func(ctx context.Context, s *RedisService, students []models.Student) error {
+		for _, student := range students {
+			if err := s.AddStudent(ctx, student); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
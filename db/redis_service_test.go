@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"rollcall-server-go/models"
+)
+
+// newTestService starts an in-memory Redis, skipping the test or benchmark if it can't be started
+func newTestService(tb testing.TB) (*RedisService, *miniredis.Miniredis) {
+	tb.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		tb.Skipf("Redis unavailable: %v", err)
+	}
+	tb.Cleanup(mr.Close)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	tb.Cleanup(func() { _ = client.Close() })
+	return NewRedisService(client), mr
+}
+
+func TestGetRandomStudentNoRepeatRound(t *testing.T) {
+	s, mr := newTestService(t)
+	ctx := context.Background()
+
+	roster := []string{"S1", "S2", "S3", "S4"}
+	for _, id := range roster {
+		if err := s.AddStudent(ctx, models.Student{ID: id, Name: "Student " + id, ClassID: "C1"}); err != nil {
+			t.Fatalf("AddStudent(%s): %v", id, err)
+		}
+	}
+
+	picked := make(map[string]bool)
+	for i := range roster {
+		student, remaining, err := s.GetRandomStudentNoRepeat(ctx, "C1")
+		if err != nil {
+			t.Fatalf("pick %d: %v", i+1, err)
+		}
+		if student == nil {
+			t.Fatalf("pick %d: got no student", i+1)
+		}
+		if picked[student.ID] {
+			t.Fatalf("pick %d: student %s picked twice in one round", i+1, student.ID)
+		}
+		picked[student.ID] = true
+		if want := len(roster) - i - 1; remaining != want {
+			t.Errorf("pick %d: remaining = %d, want %d", i+1, remaining, want)
+		}
+	}
+
+	// The last pick of a round clears the called set
+	if mr.Exists(getClassCalledKey("C1")) {
+		t.Errorf("called set still exists after a full round")
+	}
+
+	student, remaining, err := s.GetRandomStudentNoRepeat(ctx, "C1")
+	if err != nil {
+		t.Fatalf("first pick of new round: %v", err)
+	}
+	if student == nil || remaining != len(roster)-1 {
+		t.Errorf("first pick of new round: student = %v, remaining = %d, want %d", student, remaining, len(roster)-1)
+	}
+}
+
+func TestGetRandomStudentNoRepeatEmptyClass(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	if err := s.AddClass(ctx, models.Clazz{ID: "C1", Name: "Empty"}); err != nil {
+		t.Fatalf("AddClass: %v", err)
+	}
+	student, remaining, err := s.GetRandomStudentNoRepeat(ctx, "C1")
+	if err != nil || student != nil || remaining != 0 {
+		t.Errorf("got (%v, %d, %v), want (nil, 0, nil)", student, remaining, err)
+	}
+}
+
+func TestAddClassRejectsDuplicate(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	if err := s.AddClass(ctx, models.Clazz{ID: "C1", Name: "Original"}); err != nil {
+		t.Fatalf("AddClass: %v", err)
+	}
+	err := s.AddClass(ctx, models.Clazz{ID: "C1", Name: "Clobbered"})
+	if !errors.Is(err, ErrClassAlreadyExists) {
+		t.Fatalf("second AddClass error = %v, want ErrClassAlreadyExists", err)
+	}
+
+	clazz, err := s.GetClassByID(ctx, "C1")
+	if err != nil {
+		t.Fatalf("GetClassByID: %v", err)
+	}
+	if clazz == nil || clazz.Name != "Original" {
+		t.Errorf("class after duplicate add = %v, want name %q", clazz, "Original")
+	}
+}
+
+func TestAddStudentRejectsDuplicate(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	if err := s.AddStudent(ctx, models.Student{ID: "S1", Name: "Original", ClassID: "C1"}); err != nil {
+		t.Fatalf("AddStudent: %v", err)
+	}
+	err := s.AddStudent(ctx, models.Student{ID: "S1", Name: "Clobbered", ClassID: "C1"})
+	if !errors.Is(err, ErrStudentAlreadyExists) {
+		t.Fatalf("second AddStudent error = %v, want ErrStudentAlreadyExists", err)
+	}
+
+	student, err := s.GetStudentByID(ctx, "S1")
+	if err != nil {
+		t.Fatalf("GetStudentByID: %v", err)
+	}
+	if student == nil || student.Name != "Original" {
+		t.Errorf("student after duplicate add = %v, want name %q", student, "Original")
+	}
+}
@@ -1,8 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"log"
+	"mime"
 	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"rollcall-server-go/db"     // Adjust import path
@@ -25,7 +32,7 @@ func NewAPIHandler(service *db.RedisService) *APIHandler {
 
 // GetAllClasses handles GET /api/classes
 func (h *APIHandler) GetAllClasses(c *gin.Context) {
-	classes, err := h.RedisService.GetAllClasses()
+	classes, err := h.RedisService.GetAllClasses(c.Request.Context())
 	if err != nil {
 		log.Printf("Error in GetAllClasses handler: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve classes"})
@@ -47,7 +54,7 @@ func (h *APIHandler) GetClassByID(c *gin.Context) {
 		return
 	}
 
-	clazz, err := h.RedisService.GetClassByID(classID)
+	clazz, err := h.RedisService.GetClassByID(c.Request.Context(), classID)
 	if err != nil {
 		log.Printf("Error in GetClassByID handler for ID %s: %v", classID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve class details"})
@@ -75,10 +82,13 @@ func (h *APIHandler) AddClass(c *gin.Context) {
 		return
 	}
 
-	err := h.RedisService.AddClass(newClass)
+	err := h.RedisService.AddClass(c.Request.Context(), newClass)
 	if err != nil {
+		if errors.Is(err, db.ErrClassAlreadyExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Class with ID " + newClass.ID + " already exists"})
+			return
+		}
 		log.Printf("Error in AddClass handler: %v", err)
-		// Check for specific errors if needed, e.g., duplicate ID if not handled by RedisService
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add class"})
 		return
 	}
@@ -86,9 +96,75 @@ func (h *APIHandler) AddClass(c *gin.Context) {
 	c.JSON(http.StatusCreated, newClass)
 }
 
+// UpdateClass handles PUT /api/classes/:classId
+func (h *APIHandler) UpdateClass(c *gin.Context) {
+	classID := c.Param("classId")
+	if classID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class ID is required"})
+		return
+	}
+
+	var updated models.Clazz
+	if err := c.ShouldBindJSON(&updated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if updated.ID != "" && updated.ID != classID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class ID in body does not match URL"})
+		return
+	}
+	if updated.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class Name is required"})
+		return
+	}
+	updated.ID = classID
+
+	err := h.RedisService.UpdateClass(c.Request.Context(), updated)
+	if err != nil {
+		if errors.Is(err, db.ErrClassNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+			return
+		}
+		log.Printf("Error in UpdateClass handler for ID %s: %v", classID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update class"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteClass handles DELETE /api/classes/:classId
+func (h *APIHandler) DeleteClass(c *gin.Context) {
+	classID := c.Param("classId")
+	if classID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class ID is required"})
+		return
+	}
+
+	err := h.RedisService.DeleteClass(c.Request.Context(), classID)
+	if err != nil {
+		if errors.Is(err, db.ErrClassNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+			return
+		}
+		log.Printf("Error in DeleteClass handler for ID %s: %v", classID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete class"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Class deleted", "classId": classID})
+}
+
 // --- Student Handlers ---
 
+// Page size limits for GET /api/classes/:classId/students
+const (
+	defaultStudentPageSize = 50
+	maxStudentPageSize     = 500
+)
+
 // GetStudentsByClass handles GET /api/classes/:classId/students
+// Supports ?offset=, ?limit= (default 50, capped at 500) and ?name= substring filtering; results are sorted by ID.
 func (h *APIHandler) GetStudentsByClass(c *gin.Context) {
 	classID := c.Param("classId")
 	if classID == "" {
@@ -96,8 +172,31 @@ func (h *APIHandler) GetStudentsByClass(c *gin.Context) {
 		return
 	}
 
+	offset := 0
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		n, err := strconv.Atoi(offsetStr)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+			return
+		}
+		offset = n
+	}
+
+	limit := defaultStudentPageSize
+	if limitStr := c.Query("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = n
+	}
+	if limit > maxStudentPageSize {
+		limit = maxStudentPageSize
+	}
+
 	// Optional: Check if class exists first
-	exists, err := h.RedisService.ClassExists(classID)
+	exists, err := h.RedisService.ClassExists(c.Request.Context(), classID)
 	if err != nil {
 		log.Printf("Error checking class existence in GetStudentsByClass handler for ID %s: %v", classID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify class"})
@@ -108,12 +207,15 @@ func (h *APIHandler) GetStudentsByClass(c *gin.Context) {
 		return
 	}
 
-	students, err := h.RedisService.GetStudentsByClassID(classID)
+	students, total, err := h.RedisService.GetStudentsByClassPaged(c.Request.Context(), classID, offset, limit, c.Query("name"))
 	if err != nil {
 		log.Printf("Error in GetStudentsByClass handler for ID %s: %v", classID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve students for the class"})
 		return
 	}
+
+	// The body stays a plain array, the pager reads the total matching count from this header
+	c.Header("X-Total-Count", strconv.Itoa(total))
 	if students == nil {
 		c.JSON(http.StatusOK, []models.Student{})
 		return
@@ -123,6 +225,8 @@ func (h *APIHandler) GetStudentsByClass(c *gin.Context) {
 }
 
 // GetRandomStudent handles GET /api/classes/:classId/random-student
+// With ?mode=no-repeat, students already picked in the current round are excluded until everyone has been picked.
+// With ?count=N (N > 1), N distinct students are returned as an array; otherwise a single student object is returned.
 func (h *APIHandler) GetRandomStudent(c *gin.Context) {
 	classID := c.Param("classId")
 	if classID == "" {
@@ -130,7 +234,49 @@ func (h *APIHandler) GetRandomStudent(c *gin.Context) {
 		return
 	}
 
-	student, err := h.RedisService.GetRandomStudent(classID)
+	mode := c.Query("mode")
+	if mode != "" && mode != "no-repeat" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mode, expected 'no-repeat'"})
+		return
+	}
+
+	count := 1
+	if countStr := c.Query("count"); countStr != "" {
+		n, err := strconv.Atoi(countStr)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "count must be a positive integer"})
+			return
+		}
+		count = n
+	}
+
+	if count > 1 {
+		if mode == "no-repeat" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "count is not supported with mode=no-repeat"})
+			return
+		}
+		students, err := h.RedisService.GetRandomStudents(c.Request.Context(), classID, count)
+		if err != nil {
+			log.Printf("Error in GetRandomStudent handler for ID %s (count %d): %v", classID, count, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get random students"})
+			return
+		}
+		if len(students) == 0 {
+			h.respondNoStudents(c, classID)
+			return
+		}
+		c.JSON(http.StatusOK, students)
+		return
+	}
+
+	var student *models.Student
+	var remaining int
+	var err error
+	if mode == "no-repeat" {
+		student, remaining, err = h.RedisService.GetRandomStudentNoRepeat(c.Request.Context(), classID)
+	} else {
+		student, err = h.RedisService.GetRandomStudent(c.Request.Context(), classID)
+	}
 	if err != nil {
 		log.Printf("Error in GetRandomStudent handler for ID %s: %v", classID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get random student"})
@@ -138,20 +284,220 @@ func (h *APIHandler) GetRandomStudent(c *gin.Context) {
 	}
 
 	if student == nil {
-		// Could mean class not found, or class has no students.
-		// Check if class exists to differentiate maybe?
-		exists, _ := h.RedisService.ClassExists(classID)
-		if !exists {
-			c.JSON(http.StatusNotFound, gin.H{"message": "Class not found"})
-		} else {
-			c.JSON(http.StatusNotFound, gin.H{"message": "No students found in this class"})
-		}
+		h.respondNoStudents(c, classID)
+		return
+	}
+
+	if mode == "no-repeat" {
+		c.JSON(http.StatusOK, gin.H{
+			"student":   student,
+			"remaining": remaining, // Students not yet picked in the current round
+		})
 		return
 	}
 
 	c.JSON(http.StatusOK, student)
 }
 
+// respondNoStudents writes the 404 for a random pick that found nothing
+func (h *APIHandler) respondNoStudents(c *gin.Context, classID string) {
+	// Could mean class not found, or class has no students.
+	exists, _ := h.RedisService.ClassExists(c.Request.Context(), classID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Class not found"})
+	} else {
+		c.JSON(http.StatusNotFound, gin.H{"message": "No students found in this class"})
+	}
+}
+
+// ResetRollcall handles POST /api/classes/:classId/reset-rollcall
+func (h *APIHandler) ResetRollcall(c *gin.Context) {
+	classID := c.Param("classId")
+	if classID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class ID is required"})
+		return
+	}
+
+	exists, err := h.RedisService.ClassExists(c.Request.Context(), classID)
+	if err != nil {
+		log.Printf("Error checking class existence in ResetRollcall handler for ID %s: %v", classID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify class"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+		return
+	}
+
+	if err := h.RedisService.ResetRollcall(c.Request.Context(), classID); err != nil {
+		log.Printf("Error in ResetRollcall handler for ID %s: %v", classID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset roll call"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Roll call reset", "classId": classID})
+}
+
+// UpdateStudent handles PUT /api/classes/:classId/students/:studentId
+// The body's classId may differ from the URL to move the student to another existing class.
+func (h *APIHandler) UpdateStudent(c *gin.Context) {
+	classID := c.Param("classId")
+	studentID := c.Param("studentId")
+	if classID == "" || studentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class ID and Student ID are required"})
+		return
+	}
+
+	var updated models.Student
+	if err := c.ShouldBindJSON(&updated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if updated.ID != "" && updated.ID != studentID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Student ID in body does not match URL"})
+		return
+	}
+	if updated.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Student Name is required"})
+		return
+	}
+	updated.ID = studentID
+	if updated.ClassID == "" {
+		updated.ClassID = classID // Keep the student in its current class
+	}
+
+	// Make sure the student actually belongs to the class in the URL
+	student, err := h.RedisService.GetStudentByID(c.Request.Context(), studentID)
+	if err != nil {
+		log.Printf("Error fetching student %s in UpdateStudent handler: %v", studentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify student"})
+		return
+	}
+	if student == nil || student.ClassID != classID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found in this class"})
+		return
+	}
+
+	err = h.RedisService.UpdateStudent(c.Request.Context(), updated)
+	if err != nil {
+		if errors.Is(err, db.ErrStudentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found in this class"})
+			return
+		}
+		if errors.Is(err, db.ErrClassNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Target class does not exist"})
+			return
+		}
+		log.Printf("Error in UpdateStudent handler for ID %s: %v", studentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update student"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteStudent handles DELETE /api/classes/:classId/students/:studentId
+func (h *APIHandler) DeleteStudent(c *gin.Context) {
+	classID := c.Param("classId")
+	studentID := c.Param("studentId")
+	if classID == "" || studentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class ID and Student ID are required"})
+		return
+	}
+
+	// Make sure the student actually belongs to the class in the URL
+	student, err := h.RedisService.GetStudentByID(c.Request.Context(), studentID)
+	if err != nil {
+		log.Printf("Error fetching student %s in DeleteStudent handler: %v", studentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify student"})
+		return
+	}
+	if student == nil || student.ClassID != classID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found in this class"})
+		return
+	}
+
+	err = h.RedisService.DeleteStudent(c.Request.Context(), studentID)
+	if err != nil {
+		if errors.Is(err, db.ErrStudentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found in this class"})
+			return
+		}
+		log.Printf("Error in DeleteStudent handler for ID %s: %v", studentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete student"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Student deleted", "studentId": studentID, "classId": classID})
+}
+
+// --- History Handler ---
+
+// GetRollcallHistory handles GET /api/classes/:classId/history
+// ?since= accepts an RFC 3339 timestamp, a YYYY-MM-DD date (start of that day, server local time) or unix seconds.
+func (h *APIHandler) GetRollcallHistory(c *gin.Context) {
+	classID := c.Param("classId")
+	if classID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class ID is required"})
+		return
+	}
+
+	var since time.Time
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		parsed, ok := parseSince(sinceStr)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 timestamp, YYYY-MM-DD date or unix seconds"})
+			return
+		}
+		since = parsed
+	}
+
+	exists, err := h.RedisService.ClassExists(c.Request.Context(), classID)
+	if err != nil {
+		log.Printf("Error checking class existence in GetRollcallHistory handler for ID %s: %v", classID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify class"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+		return
+	}
+
+	entries, err := h.RedisService.GetRollcallHistory(c.Request.Context(), classID, since)
+	if err != nil {
+		log.Printf("Error in GetRollcallHistory handler for ID %s: %v", classID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve roll call history"})
+		return
+	}
+	// Counts come from the same entries so both views always agree
+	counts, err := h.RedisService.GetPickCounts(c.Request.Context(), classID, entries)
+	if err != nil {
+		log.Printf("Error getting pick counts in GetRollcallHistory handler for ID %s: %v", classID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve roll call history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"classId":    classID,
+		"history":    entries,
+		"pickCounts": counts, // Every current student, least picked first
+	})
+}
+
+// parseSince parses the since query parameter of the history endpoint
+func parseSince(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), true
+	}
+	return time.Time{}, false
+}
+
 // --- Import Handler ---
 
 // ImportStudents handles POST /api/import/students
@@ -175,24 +521,81 @@ func (h *APIHandler) ImportStudents(c *gin.Context) {
 	log.Printf("Received file upload: %s for class: %s", header.Filename, classID)
 
 	// Call the service layer to process the import
-	importedCount, err := h.RedisService.ImportStudentsFromExcel(file, classID)
+	// Route by file extension, anything that isn't CSV is treated as xlsx
+	var result models.ImportResult
+	if strings.EqualFold(filepath.Ext(header.Filename), ".csv") {
+		result, err = h.RedisService.ImportStudentsFromCSV(c.Request.Context(), file, classID)
+	} else {
+		result, err = h.RedisService.ImportStudentsFromExcel(c.Request.Context(), file, classID)
+	}
 	if err != nil {
 		log.Printf("Error importing students from file %s for class %s: %v", header.Filename, classID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to import students: " + err.Error()})
 		return
 	}
 
-	// Success response
+	message := "Import successful"
+	if len(result.SkippedRows) > 0 {
+		message = "Import completed with skipped rows"
+	}
+
+	// Success response, skipped rows let the uploader fix exactly the rejected lines
 	c.JSON(http.StatusOK, gin.H{
-		"message":       "Import successful",
-		"importedCount": importedCount,
+		"message":       message,
+		"importedCount": result.ImportedCount,
+		"skippedCount":  len(result.SkippedRows),
+		"skippedRows":   result.SkippedRows,
 		"classId":       classID,
 	})
 }
 
-// --- Ping Handler ---
+// --- Export Handler ---
+
+// ExportStudents handles GET /api/classes/:classId/export
+func (h *APIHandler) ExportStudents(c *gin.Context) {
+	classID := c.Param("classId")
+	if classID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Class ID is required"})
+		return
+	}
+
+	file, err := h.RedisService.ExportStudentsToExcel(c.Request.Context(), classID)
+	if err != nil {
+		if errors.Is(err, db.ErrClassNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+			return
+		}
+		log.Printf("Error exporting students for class %s: %v", classID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export students"})
+		return
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": "class_" + classID + ".xlsx"})
+	c.DataFromReader(http.StatusOK, -1,
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		file,
+		map[string]string{"Content-Disposition": disposition},
+	)
+}
+
+// --- Health Handlers ---
+
+// healthCheckTimeout bounds how long the readiness probe waits on Redis
+const healthCheckTimeout = 2 * time.Second
+
+// Health handles GET /api/health, reporting ready only if Redis answers a PING
+func (h *APIHandler) Health(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+	defer cancel()
+	if err := h.RedisService.Ping(ctx); err != nil {
+		log.Printf("Health check failed, Redis is unreachable: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "degraded", "redis": "down"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "redis": "up"})
+}
+
+// PingHandler is a liveness check that does not touch Redis, see Health for the readiness probe
 func PingHandler(c *gin.Context) {
-	// You might want to inject the redis client here too to ping it
-	// For now, just a simple pong
 	c.JSON(http.StatusOK, gin.H{"message": "Pong!"})
 }
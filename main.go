@@ -4,6 +4,8 @@ import (
 	"context" // <--- 添加 context 包导入
 	"errors"  // <--- 添加 errors 包导入 (用于检查 redis.Nil)
 	"log"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8" // <--- 添加 redis 包导入 (用于 redis.Nil 和 client 类型)
@@ -22,6 +24,13 @@ func main() {
 
 	// Create Redis Service
 	redisService := db.NewRedisService(redisClient)
+	if timeoutStr := os.Getenv("REDIS_OP_TIMEOUT"); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			log.Fatalf("Invalid REDIS_OP_TIMEOUT value %q: must be a duration such as 3s or 500ms", timeoutStr)
+		}
+		redisService.OpTimeout = timeout
+	}
 
 	// --- 检查并添加初始测试数据 ---
 	checkAndSeedData(redisClient, redisService)
@@ -41,20 +50,35 @@ func main() {
 		api.GET("/classes", apiHandler.GetAllClasses)
 		api.GET("/classes/:classId", apiHandler.GetClassByID)
 		api.POST("/classes", apiHandler.AddClass) // Added for manual/test addition
+		api.PUT("/classes/:classId", apiHandler.UpdateClass)
+		api.DELETE("/classes/:classId", apiHandler.DeleteClass)
 
 		// Student routes within a class
 		api.GET("/classes/:classId/students", apiHandler.GetStudentsByClass)
 		api.GET("/classes/:classId/random-student", apiHandler.GetRandomStudent)
+		api.POST("/classes/:classId/reset-rollcall", apiHandler.ResetRollcall)
+		api.GET("/classes/:classId/history", apiHandler.GetRollcallHistory)
+		api.PUT("/classes/:classId/students/:studentId", apiHandler.UpdateStudent)
+		api.DELETE("/classes/:classId/students/:studentId", apiHandler.DeleteStudent)
 
 		// Import route
 		api.POST("/import/students", apiHandler.ImportStudents)
 
+		// Export route
+		api.GET("/classes/:classId/export", apiHandler.ExportStudents)
+
 		// Ping route (moved under /api for consistency)
 		api.GET("/ping", handlers.PingHandler)
+
+		// Readiness probe, checks Redis connectivity
+		api.GET("/health", apiHandler.Health)
 	}
 
 	// Start the server
-	port := ":8080" // Or get from environment variable
+	port := ":8080"
+	if envPort := os.Getenv("PORT"); envPort != "" {
+		port = ":" + envPort
+	}
 	log.Printf("Starting server on port %s", port)
 	if err := router.Run(port); err != nil {
 		log.Fatalf("Failed to run server: %v", err)
@@ -76,14 +100,14 @@ func checkAndSeedData(client *redis.Client, service *db.RedisService) {
 	// 如果 count 为 0 (表示 key 不存在或为空)，则添加测试数据
 	if count == 0 {
 		log.Printf("在 Redis 中未找到现有班级数据 (Key: '%s')。正在添加初始测试数据...", classesKeyForCheck)
-		seedInitialData(service) // 调用添加数据的函数
+		seedInitialData(ctx, service) // 调用添加数据的函数
 	} else {
 		log.Printf("在 Redis 中找到现有数据 (Key: '%s', 数量: %d)。跳过添加测试数据。", classesKeyForCheck, count)
 	}
 }
 
 // seedInitialData 添加预设的测试班级和学生数据
-func seedInitialData(s *db.RedisService) {
+func seedInitialData(ctx context.Context, s *db.RedisService) {
 	log.Println("正在添加初始测试数据...")
 
 	// 定义测试班级
@@ -91,11 +115,11 @@ func seedInitialData(s *db.RedisService) {
 	class2 := models.Clazz{ID: "C_TEST_EE02", Name: "测试电子班"}
 
 	// 添加测试班级 (打印错误但不中断)
-	err1 := s.AddClass(class1)
+	err1 := s.AddClass(ctx, class1)
 	if err1 != nil {
 		log.Printf("添加测试班级 %s 时出错: %v", class1.ID, err1)
 	}
-	err2 := s.AddClass(class2)
+	err2 := s.AddClass(ctx, class2)
 	if err2 != nil {
 		log.Printf("添加测试班级 %s 时出错: %v", class2.ID, err2)
 	}
@@ -106,15 +130,15 @@ func seedInitialData(s *db.RedisService) {
 	student3 := models.Student{ID: "S_TEST_EE02_001", Name: "王五 (测试)", ClassID: class2.ID}
 
 	// 添加测试学生 (使用 _ 忽略错误，或者也进行错误处理)
-	err := s.AddStudent(student1)
+	err := s.AddStudent(ctx, student1)
 	if err != nil {
 		log.Printf("添加测试学生 %s 时出错: %v", student1.ID, err)
 	}
-	err = s.AddStudent(student2)
+	err = s.AddStudent(ctx, student2)
 	if err != nil {
 		log.Printf("添加测试学生 %s 时出错: %v", student2.ID, err)
 	}
-	err = s.AddStudent(student3)
+	err = s.AddStudent(ctx, student3)
 	if err != nil {
 		log.Printf("添加测试学生 %s 时出错: %v", student3.ID, err)
 	}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // Clazz represents a class
 type Clazz struct {
 	ID   string `json:"id"`   // Unique class ID
@@ -12,3 +14,29 @@ type Student struct {
 	Name    string `json:"name"`    // Student name
 	ClassID string `json:"classId"` // ID of the class the student belongs to
 }
+
+// RowError describes a spreadsheet row that was skipped during import
+type RowError struct {
+	Row    int    `json:"row"`    // 1-based row number as shown in Excel (row 1 is the header)
+	Reason string `json:"reason"` // Why the row was skipped, e.g. "missing ID"
+}
+
+// ImportResult summarizes the outcome of a student import
+type ImportResult struct {
+	ImportedCount int        `json:"importedCount"` // Number of students successfully added
+	SkippedRows   []RowError `json:"skippedRows"`   // Rows that were rejected, in row order
+}
+
+// HistoryEntry records a single roll-call pick
+type HistoryEntry struct {
+	StudentID string    `json:"studentId"` // ID of the picked student
+	Name      string    `json:"name"`      // Student name, empty if the student has since been deleted
+	PickedAt  time.Time `json:"pickedAt"`  // When the student was picked
+}
+
+// PickCount is how many times a student has been picked in a history window
+type PickCount struct {
+	StudentID string `json:"studentId"` // ID of the student
+	Name      string `json:"name"`      // Student name
+	Count     int    `json:"count"`     // 0 means the student has not been called
+}